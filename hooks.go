@@ -0,0 +1,124 @@
+package migrations
+
+import (
+	"github.com/go-pg/pg/v9"
+)
+
+// MigrationHook is a callback run around every migration's Up or Down, via
+// OnBeforeMigration/OnAfterMigration. It receives the migration name and
+// the transaction the migration is running in, and runs inside that same
+// transaction, so a returned error aborts the whole batch.
+type MigrationHook func(name string, tx *pg.Tx) error
+
+// MigrationErrorHook is a callback run via OnError whenever a migration,
+// or one of its hooks, fails. Its own error is logged but never shadows
+// the error that triggered it.
+type MigrationErrorHook func(name string, err error) error
+
+// OnBeforeMigration hooks run, in order, before every migration's Up or
+// Down, inside the same transaction as the migration.
+var OnBeforeMigration []MigrationHook
+
+// OnAfterMigration hooks run, in order, after every migration's Up or
+// Down succeeds, inside the same transaction as the migration.
+var OnAfterMigration []MigrationHook
+
+// OnError hooks run, in order, whenever a migration or one of its
+// before/after hooks fails.
+var OnError []MigrationErrorHook
+
+// MigrationOptions is the options-struct form of Register, for migrations
+// that need BeforeUp/AfterUp/BeforeDown/AfterDown callbacks, e.g. for
+// instrumentation, cache invalidation or data-fix steps around a migration.
+type MigrationOptions struct {
+	Name string
+	Up   func(*pg.Tx) error
+	Down func(*pg.Tx) error
+
+	BeforeUp   func(*pg.Tx) error
+	AfterUp    func(*pg.Tx) error
+	BeforeDown func(*pg.Tx) error
+	AfterDown  func(*pg.Tx) error
+}
+
+// RegisterWithHooks registers a migration along with per-migration
+// lifecycle callbacks. All callbacks run inside the same transaction as
+// the migration, so a failure at any step aborts the whole batch.
+func RegisterWithHooks(opts MigrationOptions) {
+	migrationNames = append(migrationNames, opts.Name)
+
+	allMigrations[opts.Name] = migration{
+		Name:       opts.Name,
+		Up:         opts.Up,
+		Down:       opts.Down,
+		BeforeUp:   opts.BeforeUp,
+		AfterUp:    opts.AfterUp,
+		BeforeDown: opts.BeforeDown,
+		AfterDown:  opts.AfterDown,
+	}
+}
+
+func runMigrationUp(tx *pg.Tx, name string) error {
+	m := allMigrations[name]
+
+	err := runHookChain(OnBeforeMigration, name, tx)
+	if err == nil && m.BeforeUp != nil {
+		err = m.BeforeUp(tx)
+	}
+	if err == nil {
+		err = m.Up(tx)
+	}
+	if err == nil && m.AfterUp != nil {
+		err = m.AfterUp(tx)
+	}
+	if err == nil {
+		err = runHookChain(OnAfterMigration, name, tx)
+	}
+
+	if err != nil {
+		notifyOnError(name, err)
+	}
+
+	return err
+}
+
+func runMigrationDown(tx *pg.Tx, name string) error {
+	m := allMigrations[name]
+
+	err := runHookChain(OnBeforeMigration, name, tx)
+	if err == nil && m.BeforeDown != nil {
+		err = m.BeforeDown(tx)
+	}
+	if err == nil {
+		err = m.Down(tx)
+	}
+	if err == nil && m.AfterDown != nil {
+		err = m.AfterDown(tx)
+	}
+	if err == nil {
+		err = runHookChain(OnAfterMigration, name, tx)
+	}
+
+	if err != nil {
+		notifyOnError(name, err)
+	}
+
+	return err
+}
+
+func runHookChain(hooks []MigrationHook, name string, tx *pg.Tx) error {
+	for _, hook := range hooks {
+		if err := hook(name, tx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func notifyOnError(name string, originalErr error) {
+	for _, hook := range OnError {
+		if hookErr := hook(name, originalErr); hookErr != nil {
+			pkgLogger.Warnf("OnError hook for %s failed: %v", name, hookErr)
+		}
+	}
+}
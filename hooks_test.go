@@ -0,0 +1,140 @@
+package migrations
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-pg/pg/v9"
+	"github.com/pkg/errors"
+)
+
+func TestRunHookChain(t *testing.T) {
+	var calls []string
+	hooks := []MigrationHook{
+		func(name string, tx *pg.Tx) error { calls = append(calls, "a:"+name); return nil },
+		func(name string, tx *pg.Tx) error { calls = append(calls, "b:"+name); return nil },
+	}
+
+	if err := runHookChain(hooks, "mig", nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []string{"a:mig", "b:mig"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+}
+
+func TestRunHookChainShortCircuitsOnError(t *testing.T) {
+	var calls []string
+	boom := errors.New("boom")
+	hooks := []MigrationHook{
+		func(name string, tx *pg.Tx) error { calls = append(calls, "a"); return boom },
+		func(name string, tx *pg.Tx) error { calls = append(calls, "b"); return nil },
+	}
+
+	err := runHookChain(hooks, "mig", nil)
+	if errors.Cause(err) != boom {
+		t.Fatalf("err = %v, want %v", err, boom)
+	}
+	if !reflect.DeepEqual(calls, []string{"a"}) {
+		t.Errorf("calls = %v, want [a] (second hook must not run)", calls)
+	}
+}
+
+func withHookState(t *testing.T, fn func()) {
+	t.Helper()
+	origAll := allMigrations
+	origBefore, origAfter, origError := OnBeforeMigration, OnAfterMigration, OnError
+	defer func() {
+		allMigrations = origAll
+		OnBeforeMigration, OnAfterMigration, OnError = origBefore, origAfter, origError
+	}()
+
+	allMigrations = map[string]migration{}
+	OnBeforeMigration, OnAfterMigration, OnError = nil, nil, nil
+	fn()
+}
+
+func TestRunMigrationUpRunsHooksInOrder(t *testing.T) {
+	withHookState(t, func() {
+		var calls []string
+
+		OnBeforeMigration = []MigrationHook{
+			func(name string, tx *pg.Tx) error { calls = append(calls, "global-before"); return nil },
+		}
+		OnAfterMigration = []MigrationHook{
+			func(name string, tx *pg.Tx) error { calls = append(calls, "global-after"); return nil },
+		}
+
+		allMigrations["mig"] = migration{
+			Name:     "mig",
+			Up:       func(tx *pg.Tx) error { calls = append(calls, "up"); return nil },
+			BeforeUp: func(tx *pg.Tx) error { calls = append(calls, "before-up"); return nil },
+			AfterUp:  func(tx *pg.Tx) error { calls = append(calls, "after-up"); return nil },
+		}
+
+		if err := runMigrationUp(nil, "mig"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		want := []string{"global-before", "before-up", "up", "after-up", "global-after"}
+		if !reflect.DeepEqual(calls, want) {
+			t.Errorf("calls = %v, want %v", calls, want)
+		}
+	})
+}
+
+func TestRunMigrationUpStopsOnErrorAndNotifiesOnError(t *testing.T) {
+	withHookState(t, func() {
+		var calls []string
+		boom := errors.New("boom")
+
+		var notified []string
+		OnError = []MigrationErrorHook{
+			func(name string, err error) error {
+				notified = append(notified, name)
+				return nil
+			},
+		}
+
+		allMigrations["mig"] = migration{
+			Name:    "mig",
+			Up:      func(tx *pg.Tx) error { calls = append(calls, "up"); return boom },
+			AfterUp: func(tx *pg.Tx) error { calls = append(calls, "after-up"); return nil },
+		}
+
+		err := runMigrationUp(nil, "mig")
+		if errors.Cause(err) != boom {
+			t.Fatalf("err = %v, want %v", err, boom)
+		}
+		if !reflect.DeepEqual(calls, []string{"up"}) {
+			t.Errorf("calls = %v, want [up] (AfterUp must not run)", calls)
+		}
+		if !reflect.DeepEqual(notified, []string{"mig"}) {
+			t.Errorf("OnError notified %v, want [mig]", notified)
+		}
+	})
+}
+
+func TestRunMigrationDownRunsHooksInOrder(t *testing.T) {
+	withHookState(t, func() {
+		var calls []string
+
+		allMigrations["mig"] = migration{
+			Name:       "mig",
+			Down:       func(tx *pg.Tx) error { calls = append(calls, "down"); return nil },
+			BeforeDown: func(tx *pg.Tx) error { calls = append(calls, "before-down"); return nil },
+			AfterDown:  func(tx *pg.Tx) error { calls = append(calls, "after-down"); return nil },
+		}
+
+		if err := runMigrationDown(nil, "mig"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		want := []string{"before-down", "down", "after-down"}
+		if !reflect.DeepEqual(calls, want) {
+			t.Errorf("calls = %v, want %v", calls, want)
+		}
+	})
+}
@@ -0,0 +1,118 @@
+package migrations
+
+import (
+	"hash/fnv"
+	"time"
+
+	"github.com/go-pg/pg/v9"
+	"github.com/pkg/errors"
+)
+
+// ErrLocked is returned when another process already holds the migration
+// advisory lock, so orchestrators (a Kubernetes Job, a CI step) can detect
+// a concurrent migrator and back off instead of hanging.
+var ErrLocked = errors.New("migrations: advisory lock held by another process")
+
+var lockTimeout = 10 * time.Second
+var lockRetries = 0
+var lockRetriesSet = false
+var lockRetryBackoff = time.Second
+
+// SetLockTimeout sets how long the package waits to acquire the migration
+// advisory lock before giving up with ErrLocked. Unless SetLockRetry has
+// been called, this is the only knob that matters: withAdvisoryLockFor
+// retries on this interval (using lockRetryBackoff as the sleep between
+// attempts) until the deadline passes.
+func SetLockTimeout(d time.Duration) {
+	lockTimeout = d
+}
+
+// SetLockRetry sets how many extra attempts are made to acquire the
+// migration advisory lock after an initial failed attempt, and how long to
+// sleep between attempts. Calling this switches withAdvisoryLockFor from
+// waiting out lockTimeout to waiting out exactly n retries, regardless of
+// how long that takes.
+func SetLockRetry(n int, backoff time.Duration) {
+	lockRetries = n
+	lockRetryBackoff = backoff
+	lockRetriesSet = true
+}
+
+// withAdvisoryLock takes a session-level pg_try_advisory_lock on a
+// dedicated connection before running fn, and releases it once fn returns.
+// This replaces locking the migrations table itself, which blocked every
+// reader of that table for as long as a migration ran and gave parallel
+// deployers no way to time out.
+func withAdvisoryLock(db *pg.DB, fn func() error) error {
+	return withAdvisoryLockFor(db, migrationTableName, fn)
+}
+
+// withAdvisoryLockFor is withAdvisoryLock keyed off an arbitrary name,
+// rather than migrationTableName, so independent subsystems (e.g. seeds)
+// don't contend for the same lock.
+func withAdvisoryLockFor(db *pg.DB, name string, fn func() error) error {
+	conn := db.Conn()
+	defer conn.Close()
+
+	key := advisoryLockKeyFor(name)
+	deadline := time.Now().Add(lockTimeout)
+
+	var locked bool
+	for attempt := 0; ; attempt++ {
+		var err error
+		locked, err = tryAdvisoryLock(conn, key)
+		if err != nil {
+			return err
+		}
+		if locked {
+			break
+		}
+
+		if !shouldRetryLock(attempt, time.Now(), deadline) {
+			break
+		}
+
+		time.Sleep(lockRetryBackoff)
+	}
+
+	if !locked {
+		return ErrLocked
+	}
+
+	defer releaseAdvisoryLock(conn, key)
+
+	return fn()
+}
+
+// shouldRetryLock decides whether withAdvisoryLockFor should make another
+// attempt after attempt (0-indexed) has failed to acquire the lock. With an
+// explicit retry count set via SetLockRetry, it honours that count exactly;
+// otherwise it keeps retrying until now reaches deadline, so SetLockTimeout
+// alone is enough to wait out a short-lived lock holder.
+func shouldRetryLock(attempt int, now, deadline time.Time) bool {
+	if lockRetriesSet {
+		return attempt < lockRetries
+	}
+	return now.Before(deadline)
+}
+
+func advisoryLockKeyFor(name string) int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(name))
+	return int64(h.Sum64())
+}
+
+func tryAdvisoryLock(conn *pg.Conn, key int64) (bool, error) {
+	var locked bool
+	_, err := conn.QueryOne(pg.Scan(&locked), "select pg_try_advisory_lock(?)", key)
+	if err != nil {
+		return false, err
+	}
+	return locked, nil
+}
+
+func releaseAdvisoryLock(conn *pg.Conn, key int64) {
+	if _, err := conn.Exec("select pg_advisory_unlock(?)", key); err != nil {
+		pkgLogger.Warnf("failed to release migration advisory lock: %v", err)
+	}
+}
@@ -0,0 +1,82 @@
+package migrations
+
+import (
+	"testing"
+	"time"
+)
+
+func TestShouldRetryLock(t *testing.T) {
+	origSet, origRetries := lockRetriesSet, lockRetries
+	defer func() {
+		lockRetriesSet, lockRetries = origSet, origRetries
+	}()
+
+	now := time.Unix(0, 0)
+
+	cases := []struct {
+		name        string
+		retriesSet  bool
+		retries     int
+		attempt     int
+		deadline    time.Time
+		wantRetries bool
+	}{
+		{
+			name:        "no retry config, deadline in the future",
+			retriesSet:  false,
+			attempt:     0,
+			deadline:    now.Add(time.Second),
+			wantRetries: true,
+		},
+		{
+			name:        "no retry config, deadline passed",
+			retriesSet:  false,
+			attempt:     5,
+			deadline:    now.Add(-time.Second),
+			wantRetries: false,
+		},
+		{
+			name:        "no retry config, deadline exactly now",
+			retriesSet:  false,
+			attempt:     0,
+			deadline:    now,
+			wantRetries: false,
+		},
+		{
+			name:        "explicit retries, attempt under count",
+			retriesSet:  true,
+			retries:     3,
+			attempt:     2,
+			deadline:    now.Add(-time.Hour),
+			wantRetries: true,
+		},
+		{
+			name:        "explicit retries, attempt at count",
+			retriesSet:  true,
+			retries:     3,
+			attempt:     3,
+			deadline:    now.Add(time.Hour),
+			wantRetries: false,
+		},
+		{
+			name:        "explicit retries of zero never retries",
+			retriesSet:  true,
+			retries:     0,
+			attempt:     0,
+			deadline:    now.Add(time.Hour),
+			wantRetries: false,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			lockRetriesSet = c.retriesSet
+			lockRetries = c.retries
+
+			got := shouldRetryLock(c.attempt, now, c.deadline)
+			if got != c.wantRetries {
+				t.Errorf("shouldRetryLock(%d, %v, %v) = %v, want %v", c.attempt, now, c.deadline, got, c.wantRetries)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/go-pg/pg/v9"
+	"github.com/pkg/errors"
+)
+
+// Logger is the logging interface used for all progress and diagnostic
+// messages emitted while running migrations. Implementations can route
+// messages into a service's structured/JSON logs instead of stdout, or
+// silence them entirely in tests.
+type Logger interface {
+	Infof(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+var pkgLogger Logger = stdoutLogger{}
+
+// SetLogger overrides the Logger used for migration progress messages.
+// The default logger prints to stdout, matching the package's historical
+// behaviour.
+func SetLogger(l Logger) {
+	pkgLogger = l
+}
+
+type stdoutLogger struct{}
+
+func (stdoutLogger) Infof(format string, args ...interface{}) {
+	fmt.Printf(format+"\n", args...)
+}
+
+func (stdoutLogger) Warnf(format string, args ...interface{}) {
+	fmt.Printf("Warning: "+format+"\n", args...)
+}
+
+func (stdoutLogger) Errorf(format string, args ...interface{}) {
+	fmt.Printf("Error: "+format+"\n", args...)
+}
+
+var dryRun bool
+
+// SetDryRun toggles dry-run mode. While enabled, migrate/rollback still
+// open a transaction, run each migration's Up/Down and log the usual
+// progress messages, but the transaction is always rolled back afterwards
+// and the migrations table is left untouched. The SQL statements that
+// Up/Down execute are not themselves logged; only the progress messages
+// (batch, migration names) are.
+func SetDryRun(enabled bool) {
+	dryRun = enabled
+}
+
+var errDryRun = errors.New("migrations: dry run, rolling back")
+
+// runInMutatingTransaction runs fn in a transaction the same way
+// db.RunInTransaction does, except that in dry-run mode the transaction is
+// always rolled back after fn completes, whether or not fn succeeded, so
+// fn's statements leave no trace in the database.
+func runInMutatingTransaction(db *pg.DB, fn func(tx *pg.Tx) error) error {
+	err := db.RunInTransaction(func(tx *pg.Tx) error {
+		if err := fn(tx); err != nil {
+			return err
+		}
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+
+	if err == errDryRun {
+		pkgLogger.Infof("Dry run complete, rolled back")
+		return nil
+	}
+
+	return err
+}
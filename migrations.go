@@ -8,11 +8,13 @@ import (
 	"os"
 	"path"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 	"unicode"
 
 	"github.com/go-pg/pg/v9"
+	"github.com/go-pg/pg/v9/orm"
 	"github.com/pkg/errors"
 )
 
@@ -20,6 +22,11 @@ type migration struct {
 	Name string
 	Up   func(*pg.Tx) error
 	Down func(*pg.Tx) error
+
+	BeforeUp   func(*pg.Tx) error
+	AfterUp    func(*pg.Tx) error
+	BeforeDown func(*pg.Tx) error
+	AfterDown  func(*pg.Tx) error
 }
 
 type MigrationNameConvention string
@@ -60,14 +67,32 @@ func Register(name string, up, down func(*pg.Tx) error) {
 /*
 Run Runs the specified command with the options they require
 Note:
+
 	init - no options
 	migrate - one option
 		- "" for all migrations in a single batch
 		- "one-by-one" for one migration in a batch mode
 	rollback - no options
+	migrate-to - one option
+		- name - name of the migration to migrate up to, inclusive
+	rollback-steps - one option
+		- steps - number of most recently applied migrations to roll back
+	rollback-to - one option
+		- name - name of the migration to leave as the most recently applied
+	status - no options - prints applied and pending migrations
+	plan - one or two options
+		- "migrate", "migrate-to", "rollback", "rollback-steps" or "rollback-to" - prints what
+			that command would do, without running it
+		- the option that command takes (name or steps), for migrate-to, rollback-steps and rollback-to
+	seed - one option
+		- env - environment tag (e.g. "dev", "staging", "test") to run pending seeds for
+	reseed - two options
+		- env - environment tag the seed was registered under
+		- name - name of the seed to roll back and run again
 	create - two options
 		- name - name of the migration (must be first)
-		- template - string that contains the go code to use as a template. see migrationTemplate
+		- template - string that contains the go code to use as a template, or "--sql"
+			to emit a .up.sql/.down.sql file pair instead of a Go file
 */
 func Run(db *pg.DB, cmd string, options ...string) error {
 	switch cmd {
@@ -84,14 +109,68 @@ func Run(db *pg.DB, cmd string, options ...string) error {
 	case "rollback":
 		return rollback(db)
 
+	case "migrate-to":
+		if len(options) == 0 {
+			return errors.New("Please specify a target migration name")
+		}
+		return MigrateTo(db, options[0])
+
+	case "rollback-steps":
+		if len(options) == 0 {
+			return errors.New("Please specify a number of steps")
+		}
+		steps, convErr := strconv.Atoi(options[0])
+		if convErr != nil {
+			return errors.Wrapf(convErr, "invalid step count %q", options[0])
+		}
+		return RollbackSteps(db, steps)
+
+	case "rollback-to":
+		if len(options) == 0 {
+			return errors.New("Please specify a target migration name")
+		}
+		return RollbackTo(db, options[0])
+
+	case "status":
+		statuses, err := Status(db)
+		if err != nil {
+			return err
+		}
+		printStatus(statuses)
+		return nil
+
+	case "plan":
+		if len(options) == 0 {
+			return errors.New("Please specify a command to plan: migrate, migrate-to, rollback, rollback-steps or rollback-to")
+		}
+		return plan(db, options[0], options[1:]...)
+
+	case "seed":
+		if len(options) == 0 {
+			return errors.New("Please specify an environment to seed")
+		}
+		return RunSeed(db, options[0])
+
+	case "reseed":
+		if len(options) < 2 {
+			return errors.New("Please specify an environment and a seed name")
+		}
+		return ReseedSeed(db, options[0], options[1])
+
 	case "create":
 		name := ""
 		template := ""
+		sqlMode := false
 		if len(options) > 0 {
 			name = options[0]
 		}
-		if len(options) > 1 {
-			template = options[1]
+		for i := 1; i < len(options); i++ {
+			opt := options[i]
+			if opt == "--sql" {
+				sqlMode = true
+				continue
+			}
+			template = opt
 		}
 		if len(name) == 0 {
 			return errors.New("Please enter migration name")
@@ -99,6 +178,10 @@ func Run(db *pg.DB, cmd string, options ...string) error {
 
 		name = strings.Replace(name, " ", "_", -1)
 
+		if sqlMode {
+			return createSQL(name)
+		}
+
 		return create(name, template)
 	}
 
@@ -106,67 +189,85 @@ func Run(db *pg.DB, cmd string, options ...string) error {
 }
 
 func initialise(db *pg.DB) error {
-	return db.RunInTransaction(func(tx *pg.Tx) (err error) {
+	return withAdvisoryLock(db, func() error {
+		return runInMutatingTransaction(db, initialiseTx)
+	})
+}
+
+func initialiseTx(tx *pg.Tx) (err error) {
+	err = ensureMigrationsTable(tx)
+
+	if err != nil {
+		return
+	}
 
-		err = lockTable(tx)
+	migrationsToRun := []string{initialMigration}
+
+	if len(migrationsToRun) > 0 {
+		var batch int
+		batch, err = getBatchNumber(tx)
 
 		if err != nil {
 			return
 		}
 
-		migrationsToRun := []string{initialMigration}
+		batch++
 
-		if len(migrationsToRun) > 0 {
-			var batch int
-			batch, err = getBatchNumber(tx)
+		pkgLogger.Infof("Batch %d run: %d migrations", batch, len(migrationsToRun))
 
-			if err != nil {
+		for _, migration := range migrationsToRun {
+			m, ok := allMigrations[migration]
+
+			if !ok {
+				err = errors.New("Initial migration not found")
 				return
 			}
 
-			batch++
+			err = m.Up(tx)
 
-			fmt.Printf("Batch %d run: %d migrations\n", batch, len(migrationsToRun))
-
-			for _, migration := range migrationsToRun {
-				m, ok := allMigrations[migration]
-
-				if !ok {
-					err = errors.New("Initial migration not found")
-					return
-				}
-
-				err = m.Up(tx)
-
-				if err != nil {
-					return
-				}
+			if err != nil {
+				return
+			}
 
-				err = insertCompletedMigration(tx, migration, batch)
+			err = insertCompletedMigration(tx, migration, batch)
 
-				if err != nil {
-					return
-				}
+			if err != nil {
+				return
 			}
 		}
-		return
-	})
+	}
+	return
 }
 
-func getMigrationsToRun(tx *pg.Tx) ([]string, error) {
-	var migrations []string
+func getMigrationsToRun(db orm.DB) ([]string, error) {
+	migrations, err := getCompletedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	return pendingMigrations(migrations)
+}
 
-	migrations, err := getCompletedMigrations(tx)
+// getMigrationsToRunIfTableExists is getMigrationsToRun, except a
+// migrationTableName that hasn't been created yet is treated as "nothing
+// has run", not a SQL error, so read-only callers like Status/plan don't
+// have to create the table just to report on it.
+func getMigrationsToRunIfTableExists(db orm.DB) ([]string, error) {
+	migrations, err := getCompletedMigrationsIfTableExists(db)
 	if err != nil {
 		return nil, err
 	}
 
-	missingMigrations := difference(migrations, migrationNames)
+	return pendingMigrations(migrations)
+}
+
+func pendingMigrations(completed []string) ([]string, error) {
+	missingMigrations := difference(completed, migrationNames)
 	if len(missingMigrations) > 0 {
 		return nil, errors.Errorf("Migrations table corrupt: %+v", missingMigrations)
 	}
 
-	migrationsToRun := difference(migrationNames, migrations)
+	migrationsToRun := difference(migrationNames, completed)
 
 	if len(migrationsToRun) > 0 {
 		sort.Strings(migrationsToRun)
@@ -175,19 +276,21 @@ func getMigrationsToRun(tx *pg.Tx) ([]string, error) {
 	return migrationsToRun, nil
 }
 func migrate(db *pg.DB, oneByOne bool) error {
-	if oneByOne {
-		return migrateOneByOne(db)
-	}
-	return migrateOneBatch(db)
+	return withAdvisoryLock(db, func() error {
+		if oneByOne {
+			return migrateOneByOne(db)
+		}
+		return migrateOneBatch(db)
+	})
 }
 
 func migrateOneByOne(db *pg.DB) error {
 
 	var migrationsToRun []string
 
-	err := db.RunInTransaction(
+	err := runInMutatingTransaction(db,
 		func(tx *pg.Tx) (err error) {
-			err = lockTable(tx)
+			err = ensureMigrationsTable(tx)
 			if err != nil {
 				return
 			}
@@ -205,9 +308,9 @@ func migrateOneByOne(db *pg.DB) error {
 	}
 
 	for _, migration := range migrationsToRun {
-		err := db.RunInTransaction(
+		err := runInMutatingTransaction(db,
 			func(tx *pg.Tx) (err error) {
-				err = lockTable(tx)
+				err = ensureMigrationsTable(tx)
 				if err != nil {
 					return
 				}
@@ -220,9 +323,9 @@ func migrateOneByOne(db *pg.DB) error {
 
 				batch++
 
-				fmt.Printf("Batch %d run: 1 migration - %s\n", batch, migration)
+				pkgLogger.Infof("Batch %d run: 1 migration - %s", batch, migration)
 
-				err = allMigrations[migration].Up(tx)
+				err = runMigrationUp(tx, migration)
 				if err != nil {
 					err = errors.Wrapf(err, "%s failed to migrate", migration)
 					return
@@ -240,9 +343,9 @@ func migrateOneByOne(db *pg.DB) error {
 }
 
 func migrateOneBatch(db *pg.DB) error {
-	return db.RunInTransaction(func(tx *pg.Tx) (err error) {
+	return runInMutatingTransaction(db, func(tx *pg.Tx) (err error) {
 
-		err = lockTable(tx)
+		err = ensureMigrationsTable(tx)
 		if err != nil {
 			return
 		}
@@ -265,10 +368,10 @@ func migrateOneBatch(db *pg.DB) error {
 
 		batch++
 
-		fmt.Printf("Batch %d run: %d migrations\n", batch, len(migrationsToRun))
+		pkgLogger.Infof("Batch %d run: %d migrations", batch, len(migrationsToRun))
 
 		for _, migration := range migrationsToRun {
-			err = allMigrations[migration].Up(tx)
+			err = runMigrationUp(tx, migration)
 
 			if err != nil {
 				err = errors.Wrapf(err, "%s failed to migrate", migration)
@@ -287,70 +390,72 @@ func migrateOneBatch(db *pg.DB) error {
 }
 
 func rollback(db *pg.DB) error {
-	return db.RunInTransaction(func(tx *pg.Tx) (err error) {
+	return withAdvisoryLock(db, func() error {
+		return runInMutatingTransaction(db, func(tx *pg.Tx) (err error) {
 
-		err = lockTable(tx)
+			err = ensureMigrationsTable(tx)
 
-		if err != nil {
-			return
-		}
+			if err != nil {
+				return
+			}
 
-		var migrations []string
+			var migrations []string
 
-		migrations, err = getCompletedMigrations(tx)
+			migrations, err = getCompletedMigrations(tx)
 
-		if err != nil {
-			return
-		}
+			if err != nil {
+				return
+			}
 
-		missingMigrations := difference(migrations, migrationNames)
+			missingMigrations := difference(migrations, migrationNames)
 
-		if len(missingMigrations) > 0 {
-			return errors.New("Migrations table corrupt")
-		}
+			if len(missingMigrations) > 0 {
+				return errors.New("Migrations table corrupt")
+			}
 
-		var batch int
-		batch, err = getBatchNumber(tx)
+			var batch int
+			batch, err = getBatchNumber(tx)
 
-		if err != nil {
-			return
-		}
+			if err != nil {
+				return
+			}
 
-		migrationsToRun, err := getMigrationsInBatch(tx, batch)
+			migrationsToRun, err := getMigrationsInBatch(tx, batch)
 
-		if err != nil {
-			return
-		}
+			if err != nil {
+				return
+			}
 
-		if len(migrationsToRun) > 0 {
-			sort.Slice(migrationsToRun, func(i, j int) bool {
-				switch strings.Compare(migrationsToRun[i], migrationsToRun[j]) {
-				case -1:
+			if len(migrationsToRun) > 0 {
+				sort.Slice(migrationsToRun, func(i, j int) bool {
+					switch strings.Compare(migrationsToRun[i], migrationsToRun[j]) {
+					case -1:
+						return false
+					case 1:
+						return true
+					}
 					return false
-				case 1:
-					return true
-				}
-				return false
-			})
+				})
 
-			fmt.Printf("Batch %d rollback: %d migrations\n", batch, len(migrationsToRun))
+				pkgLogger.Infof("Batch %d rollback: %d migrations", batch, len(migrationsToRun))
 
-			for _, migration := range migrationsToRun {
-				err = allMigrations[migration].Down(tx)
+				for _, migration := range migrationsToRun {
+					err = runMigrationDown(tx, migration)
 
-				if err != nil {
-					err = errors.Wrapf(err, "%s failed to rollback", migration)
-					break
-				}
+					if err != nil {
+						err = errors.Wrapf(err, "%s failed to rollback", migration)
+						break
+					}
 
-				err = removeRolledbackMigration(tx, migration)
+					err = removeRolledbackMigration(tx, migration)
 
-				if err != nil {
-					return
+					if err != nil {
+						return
+					}
 				}
 			}
-		}
-		return
+			return
+		})
 	})
 }
 
@@ -372,13 +477,12 @@ func create(description, template string) error {
 		return err
 	}
 
-	fmt.Println("Created migration", filePath)
+	pkgLogger.Infof("Created migration %s", filePath)
 	return nil
 }
 
-func lockTable(tx *pg.Tx) error {
-
-	_, err := tx.Exec(`
+func ensureMigrationsTable(db orm.DB) error {
+	_, err := db.Exec(`
 			CREATE TABLE IF NOT EXISTS ? (
 				id serial,
 				name varchar,
@@ -386,16 +490,12 @@ func lockTable(tx *pg.Tx) error {
 				migration_time timestamptz
 			)
 		`, pg.Q(migrationTableName))
-	if err != nil {
-		return err
-	}
-	_, err = tx.Exec("LOCK ? ", pg.Q(migrationTableName))
 
 	return err
 }
 
 func insertCompletedMigration(tx *pg.Tx, name string, batch int) error {
-	fmt.Printf("Completed %s\n", name)
+	pkgLogger.Infof("Completed %s", name)
 	_, err := tx.Exec("insert into ? (name, batch, migration_time) values (?, ?, now())", pg.Q(migrationTableName), name, batch)
 
 	if err != nil {
@@ -406,7 +506,7 @@ func insertCompletedMigration(tx *pg.Tx, name string, batch int) error {
 }
 
 func removeRolledbackMigration(tx *pg.Tx, name string) error {
-	fmt.Printf("Rolledback %s\n", name)
+	pkgLogger.Infof("Rolledback %s", name)
 	_, err := tx.Exec("delete from ? where name = ?", pg.Q(migrationTableName), name)
 
 	if err != nil {
@@ -416,10 +516,10 @@ func removeRolledbackMigration(tx *pg.Tx, name string) error {
 	return nil
 }
 
-func getCompletedMigrations(tx *pg.Tx) ([]string, error) {
+func getCompletedMigrations(db orm.DB) ([]string, error) {
 	var results []string
 
-	_, err := tx.Query(&results, "select name from ?", pg.Q(migrationTableName))
+	_, err := db.Query(&results, "select name from ?", pg.Q(migrationTableName))
 
 	if err != nil {
 		return nil, err
@@ -428,10 +528,37 @@ func getCompletedMigrations(tx *pg.Tx) ([]string, error) {
 	return results, nil
 }
 
-func getMigrationsInBatch(tx *pg.Tx, batch int) ([]string, error) {
+// migrationsTableExists reports whether migrationTableName exists, without
+// creating it, so callers that must validate before running any DDL (e.g.
+// checking a migrate-to target is reachable) can tell a genuinely empty
+// migrations table apart from one that hasn't been created yet.
+func migrationsTableExists(db orm.DB) (bool, error) {
+	var exists bool
+
+	_, err := db.QueryOne(pg.Scan(&exists), "select to_regclass(?) is not null", migrationTableName)
+	if err != nil {
+		return false, err
+	}
+
+	return exists, nil
+}
+
+// getCompletedMigrationsIfTableExists is getCompletedMigrations, except it
+// returns an empty result instead of a SQL error when migrationTableName
+// hasn't been created yet.
+func getCompletedMigrationsIfTableExists(db orm.DB) ([]string, error) {
+	exists, err := migrationsTableExists(db)
+	if err != nil || !exists {
+		return nil, err
+	}
+
+	return getCompletedMigrations(db)
+}
+
+func getMigrationsInBatch(db orm.DB, batch int) ([]string, error) {
 	var results []string
 
-	_, err := tx.Query(&results, "select name from ? where batch = ? order by id desc", pg.Q(migrationTableName), batch)
+	_, err := db.Query(&results, "select name from ? where batch = ? order by id desc", pg.Q(migrationTableName), batch)
 
 	if err != nil {
 		return nil, err
@@ -440,10 +567,10 @@ func getMigrationsInBatch(tx *pg.Tx, batch int) ([]string, error) {
 	return results, nil
 }
 
-func getBatchNumber(tx *pg.Tx) (int, error) {
+func getBatchNumber(db orm.DB) (int, error) {
 	var result int
 
-	_, err := tx.Query(&result, "select max(batch) from ?", pg.Q(migrationTableName))
+	_, err := db.Query(&result, "select max(batch) from ?", pg.Q(migrationTableName))
 
 	if err != nil {
 		return 0, err
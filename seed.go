@@ -0,0 +1,245 @@
+package migrations
+
+import (
+	"sort"
+
+	"github.com/go-pg/pg/v9"
+	"github.com/go-pg/pg/v9/orm"
+	"github.com/pkg/errors"
+)
+
+type seed struct {
+	Name string
+	Env  string
+	Up   func(*pg.Tx) error
+	Down func(*pg.Tx) error
+}
+
+var seedTableName = "public.hb_seeds"
+var allSeeds = make(map[string]seed)
+var seedNames []string
+
+// SetSeedTableName overrides the table used to track applied seeds. It is
+// kept separate from the schema migrations table so reference data stays
+// out of the migration history.
+func SetSeedTableName(tableName string) {
+	seedTableName = tableName
+}
+
+// RegisterSeed registers a seed scoped to env (e.g. "dev", "staging",
+// "test"). Seeds are tracked independently of schema migrations and are
+// recorded in batches like migrations, but only run for a matching
+// environment and only after migrate has completed. There is no command to
+// roll back a whole seed batch; a single applied seed can be re-run, Down
+// then Up, with ReseedSeed.
+func RegisterSeed(name, env string, up, down func(*pg.Tx) error) {
+	seedNames = append(seedNames, name)
+
+	allSeeds[name] = seed{
+		Name: name,
+		Env:  env,
+		Up:   up,
+		Down: down,
+	}
+}
+
+func seedNamesForEnv(env string) []string {
+	names := make([]string, 0, len(seedNames))
+	for _, name := range seedNames {
+		if allSeeds[name].Env == env {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// RunSeed runs every pending seed registered for env, in a single batch
+// transaction, skipping seeds that have already been applied. It refuses
+// to run while schema migrations are pending, since seed data is expected
+// to run after migrate completes.
+func RunSeed(db *pg.DB, env string) error {
+	return withAdvisoryLockFor(db, seedTableName, func() error {
+		return runInMutatingTransaction(db, func(tx *pg.Tx) (err error) {
+			err = ensureMigrationsTable(tx)
+			if err != nil {
+				return
+			}
+
+			var migrationsToRun []string
+			migrationsToRun, err = getMigrationsToRun(tx)
+			if err != nil {
+				return
+			}
+
+			if len(migrationsToRun) > 0 {
+				return errors.Errorf("%d migrations are still pending; run migrate before seeding", len(migrationsToRun))
+			}
+
+			err = ensureSeedsTable(tx)
+			if err != nil {
+				return
+			}
+
+			known := seedNamesForEnv(env)
+
+			var applied []string
+			applied, err = getCompletedSeeds(tx, env)
+			if err != nil {
+				return
+			}
+
+			missing := difference(applied, known)
+			if len(missing) > 0 {
+				err = errors.Errorf("Seeds table corrupt for env %q: %+v", env, missing)
+				return
+			}
+
+			seedsToRun := difference(known, applied)
+			if len(seedsToRun) == 0 {
+				return
+			}
+			sort.Strings(seedsToRun)
+
+			var batch int
+			batch, err = getSeedBatchNumber(tx, env)
+			if err != nil {
+				return
+			}
+			batch++
+
+			pkgLogger.Infof("Seed batch %d run for %s: %d seeds", batch, env, len(seedsToRun))
+
+			for _, name := range seedsToRun {
+				err = allSeeds[name].Up(tx)
+				if err != nil {
+					err = errors.Wrapf(err, "%s failed to seed", name)
+					return
+				}
+
+				err = insertCompletedSeed(tx, name, env, batch)
+				if err != nil {
+					return
+				}
+			}
+
+			return
+		})
+	})
+}
+
+// ReseedSeed re-runs a single already-applied seed by calling its Down and
+// then its Up again, inside a single transaction, recording it under a new
+// batch. It errors if the seed is unknown, registered for a different env,
+// or has not yet been applied.
+func ReseedSeed(db *pg.DB, env, name string) error {
+	s, ok := allSeeds[name]
+	if !ok || s.Env != env {
+		return errors.Errorf("unknown seed %q for env %q", name, env)
+	}
+
+	return withAdvisoryLockFor(db, seedTableName, func() error {
+		return runInMutatingTransaction(db, func(tx *pg.Tx) (err error) {
+			err = ensureSeedsTable(tx)
+			if err != nil {
+				return
+			}
+
+			var applied []string
+			applied, err = getCompletedSeeds(tx, env)
+			if err != nil {
+				return
+			}
+
+			found := false
+			for _, a := range applied {
+				if a == name {
+					found = true
+					break
+				}
+			}
+			if !found {
+				err = errors.Errorf("seed %q has not been applied for env %q", name, env)
+				return
+			}
+
+			err = s.Down(tx)
+			if err != nil {
+				err = errors.Wrapf(err, "%s failed to reseed (down)", name)
+				return
+			}
+
+			err = removeRolledbackSeed(tx, name, env)
+			if err != nil {
+				return
+			}
+
+			var batch int
+			batch, err = getSeedBatchNumber(tx, env)
+			if err != nil {
+				return
+			}
+			batch++
+
+			pkgLogger.Infof("Reseeding %s for %s", name, env)
+
+			err = s.Up(tx)
+			if err != nil {
+				err = errors.Wrapf(err, "%s failed to reseed (up)", name)
+				return
+			}
+
+			err = insertCompletedSeed(tx, name, env, batch)
+			return
+		})
+	})
+}
+
+func ensureSeedsTable(db orm.DB) error {
+	_, err := db.Exec(`
+			CREATE TABLE IF NOT EXISTS ? (
+				id serial,
+				name varchar,
+				env varchar,
+				batch integer,
+				seed_time timestamptz
+			)
+		`, pg.Q(seedTableName))
+
+	return err
+}
+
+func getCompletedSeeds(db orm.DB, env string) ([]string, error) {
+	var results []string
+
+	_, err := db.Query(&results, "select name from ? where env = ?", pg.Q(seedTableName), env)
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+func getSeedBatchNumber(db orm.DB, env string) (int, error) {
+	var result int
+
+	_, err := db.Query(&result, "select max(batch) from ? where env = ?", pg.Q(seedTableName), env)
+	if err != nil {
+		return 0, err
+	}
+
+	return result, nil
+}
+
+func insertCompletedSeed(db orm.DB, name, env string, batch int) error {
+	pkgLogger.Infof("Seeded %s", name)
+	_, err := db.Exec("insert into ? (name, env, batch, seed_time) values (?, ?, ?, now())", pg.Q(seedTableName), name, env, batch)
+
+	return err
+}
+
+func removeRolledbackSeed(db orm.DB, name, env string) error {
+	pkgLogger.Infof("Unseeded %s", name)
+	_, err := db.Exec("delete from ? where name = ? and env = ?", pg.Q(seedTableName), name, env)
+
+	return err
+}
@@ -0,0 +1,188 @@
+package migrations
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-pg/pg/v9"
+	"github.com/pkg/errors"
+)
+
+const (
+	sqlUpMarker   = "-- +migrate Up"
+	sqlDownMarker = "-- +migrate Down"
+)
+
+// RegisterSQL registers a migration whose Up and Down steps are raw SQL,
+// for teams that prefer to keep migrations as .sql files rather than
+// compiled Go. It is wrapped into the same migration struct used by
+// Register, so migrate/rollback treat it identically.
+func RegisterSQL(name, upSQL, downSQL string) {
+	Register(name, execSQL(upSQL), execSQL(downSQL))
+}
+
+func execSQL(sql string) func(*pg.Tx) error {
+	return func(tx *pg.Tx) error {
+		if strings.TrimSpace(sql) == "" {
+			return nil
+		}
+		_, err := tx.Exec(sql)
+		return err
+	}
+}
+
+// RegisterFS walks dir within fsys for SQL migration files and registers
+// each one it finds via RegisterSQL. Two file layouts are supported:
+//
+//   - paired files named NNNNNNNNNNNN_name.up.sql / NNNNNNNNNNNN_name.down.sql
+//   - a single NNNNNNNNNNNN_name.sql file with both halves separated by
+//     "-- +migrate Up" / "-- +migrate Down" marker comments
+//
+// It is meant to be used with a Go 1.16+ //go:embed directory so migrations
+// can ship inside the binary without recompiling for every new migration.
+func RegisterFS(fsys embed.FS, dir string) error {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read migrations dir %q", dir)
+	}
+
+	ups := map[string]string{}
+	downs := map[string]string{}
+	combined := map[string]string{}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		filename := entry.Name()
+		if !strings.HasSuffix(filename, ".sql") {
+			continue
+		}
+
+		contents, err := fsys.ReadFile(path.Join(dir, filename))
+		if err != nil {
+			return errors.Wrapf(err, "failed to read migration file %q", filename)
+		}
+
+		switch {
+		case strings.HasSuffix(filename, ".up.sql"):
+			ups[strings.TrimSuffix(filename, ".up.sql")] = string(contents)
+		case strings.HasSuffix(filename, ".down.sql"):
+			downs[strings.TrimSuffix(filename, ".down.sql")] = string(contents)
+		default:
+			combined[strings.TrimSuffix(filename, ".sql")] = string(contents)
+		}
+	}
+
+	names := make([]string, 0, len(ups)+len(combined)+len(downs))
+	seen := make(map[string]bool, len(ups)+len(combined))
+	for name := range ups {
+		seen[name] = true
+		names = append(names, name)
+	}
+	for name := range combined {
+		seen[name] = true
+		names = append(names, name)
+	}
+	for name := range downs {
+		if !seen[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if upSQL, ok := ups[name]; ok {
+			RegisterSQL(name, upSQL, downs[name])
+			continue
+		}
+
+		if combinedSQL, ok := combined[name]; ok {
+			upSQL, downSQL, err := splitMigrationMarkers(combinedSQL)
+			if err != nil {
+				return errors.Wrapf(err, "migration %q", name)
+			}
+			RegisterSQL(name, upSQL, downSQL)
+			continue
+		}
+
+		// No up.sql or combined file: an orphaned down.sql, most likely left
+		// behind by a rename or typo. Register it with a no-op Up, the same
+		// way a migration missing its down.sql is already tolerated, so it
+		// still shows up in status/plan instead of being silently dropped.
+		RegisterSQL(name, "", downs[name])
+	}
+
+	return nil
+}
+
+func splitMigrationMarkers(contents string) (up, down string, err error) {
+	upIdx := strings.Index(contents, sqlUpMarker)
+	if upIdx < 0 {
+		return "", "", errors.Errorf("missing %q marker", sqlUpMarker)
+	}
+
+	downIdx := strings.Index(contents, sqlDownMarker)
+	if downIdx < 0 {
+		return contents[upIdx+len(sqlUpMarker):], "", nil
+	}
+
+	if downIdx < upIdx {
+		return "", "", errors.Errorf("%q marker must follow %q marker", sqlDownMarker, sqlUpMarker)
+	}
+
+	up = contents[upIdx+len(sqlUpMarker) : downIdx]
+	down = contents[downIdx+len(sqlDownMarker):]
+	return up, down, nil
+}
+
+func createSQL(description string) error {
+	if migrationNameConvention == SnakeCase {
+		description = convertCamelCaseToSnakeCase(description)
+	} else {
+		description = convertSnakeCaseToCamelCase(description)
+	}
+
+	filename := fmt.Sprintf("%s_%s", time.Now().Format("20060102150405"), description)
+
+	upPath, downPath, err := createSQLMigrationFiles(filename)
+	if err != nil {
+		return err
+	}
+
+	pkgLogger.Infof("Created migration %s", upPath)
+	pkgLogger.Infof("Created migration %s", downPath)
+	return nil
+}
+
+func createSQLMigrationFiles(filename string) (upPath, downPath string, err error) {
+	basepath, err := os.Getwd()
+	if err != nil {
+		return "", "", err
+	}
+
+	upPath = path.Join(basepath, filename+".up.sql")
+	downPath = path.Join(basepath, filename+".down.sql")
+
+	if _, err := os.Stat(upPath); !os.IsNotExist(err) {
+		return "", "", fmt.Errorf("file=%s already exists (%v)", filename+".up.sql", err)
+	}
+
+	if err := ioutil.WriteFile(upPath, []byte(fmt.Sprintf("-- %s.up.sql\n", filename)), 0644); err != nil {
+		return "", "", err
+	}
+
+	if err := ioutil.WriteFile(downPath, []byte(fmt.Sprintf("-- %s.down.sql\n", filename)), 0644); err != nil {
+		return "", "", err
+	}
+
+	return upPath, downPath, nil
+}
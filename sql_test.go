@@ -0,0 +1,58 @@
+package migrations
+
+import "testing"
+
+func TestSplitMigrationMarkers(t *testing.T) {
+	cases := []struct {
+		name      string
+		contents  string
+		wantUp    string
+		wantDown  string
+		wantError bool
+	}{
+		{
+			name:     "up and down",
+			contents: "-- +migrate Up\ncreate table foo();\n-- +migrate Down\ndrop table foo();\n",
+			wantUp:   "\ncreate table foo();\n",
+			wantDown: "\ndrop table foo();\n",
+		},
+		{
+			name:     "up only",
+			contents: "-- +migrate Up\ncreate table foo();\n",
+			wantUp:   "\ncreate table foo();\n",
+			wantDown: "",
+		},
+		{
+			name:      "missing up marker",
+			contents:  "create table foo();\n-- +migrate Down\ndrop table foo();\n",
+			wantError: true,
+		},
+		{
+			name:      "down marker before up marker",
+			contents:  "-- +migrate Down\ndrop table foo();\n-- +migrate Up\ncreate table foo();\n",
+			wantError: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			up, down, err := splitMigrationMarkers(c.contents)
+			if c.wantError {
+				if err == nil {
+					t.Fatalf("expected error, got none")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if up != c.wantUp {
+				t.Errorf("up = %q, want %q", up, c.wantUp)
+			}
+			if down != c.wantDown {
+				t.Errorf("down = %q, want %q", down, c.wantDown)
+			}
+		})
+	}
+}
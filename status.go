@@ -0,0 +1,265 @@
+package migrations
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-pg/pg/v9"
+	"github.com/pkg/errors"
+)
+
+// MigrationStatus describes a single migration's state relative to the
+// database: whether it has been applied, and if so in which batch and when.
+type MigrationStatus struct {
+	Name      string
+	Batch     int
+	AppliedAt time.Time
+	Pending   bool
+}
+
+// Status reads the migrations table and diffs it against the in-memory
+// migrationNames, returning one MigrationStatus per applied row, in the
+// order they were applied, followed by one per pending migration, sorted by
+// name. Any applied row that no longer exists in code is still listed, and
+// a warning naming it is logged through the package Logger.
+func Status(db *pg.DB) ([]MigrationStatus, error) {
+	exists, err := migrationsTableExists(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []struct {
+		Name          string
+		Batch         int
+		MigrationTime time.Time
+	}
+
+	if exists {
+		_, err := db.Query(&applied, "select name, batch, migration_time from ? order by id asc", pg.Q(migrationTableName))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	appliedNames := make([]string, 0, len(applied))
+	statuses := make([]MigrationStatus, 0, len(applied)+len(migrationNames))
+
+	for _, a := range applied {
+		appliedNames = append(appliedNames, a.Name)
+		statuses = append(statuses, MigrationStatus{
+			Name:      a.Name,
+			Batch:     a.Batch,
+			AppliedAt: a.MigrationTime,
+		})
+	}
+
+	corrupt := difference(appliedNames, migrationNames)
+	if len(corrupt) > 0 {
+		pkgLogger.Warnf("migrations table contains migrations no longer found in code: %+v", corrupt)
+	}
+
+	pendingNames := difference(migrationNames, appliedNames)
+	sort.Strings(pendingNames)
+	for _, name := range pendingNames {
+		statuses = append(statuses, MigrationStatus{Name: name, Pending: true})
+	}
+
+	return statuses, nil
+}
+
+func printStatus(statuses []MigrationStatus) {
+	for _, s := range statuses {
+		if s.Pending {
+			pkgLogger.Infof("pending\t-\t%s", s.Name)
+			continue
+		}
+		pkgLogger.Infof("applied\t%d\t%s\t%s", s.Batch, s.Name, s.AppliedAt.Format(time.RFC3339))
+	}
+}
+
+// plan reports what cmd (one of "migrate", "migrate-to", "rollback",
+// "rollback-steps" or "rollback-to") would do without executing it.
+func plan(db *pg.DB, cmd string, options ...string) error {
+	var (
+		names []string
+		err   error
+		label string
+	)
+
+	switch cmd {
+	case "migrate":
+		names, err = planMigrate(db, "")
+		label = "migrate"
+
+	case "migrate-to":
+		if len(options) == 0 {
+			return errors.New("Please specify a target migration name")
+		}
+		names, err = planMigrate(db, options[0])
+		label = "migrate to " + options[0]
+
+	case "rollback":
+		names, err = planRollback(db)
+		label = "rollback"
+
+	case "rollback-steps":
+		if len(options) == 0 {
+			return errors.New("Please specify a number of steps")
+		}
+		var steps int
+		steps, err = strconv.Atoi(options[0])
+		if err == nil {
+			names, err = planRollbackSteps(db, steps)
+		}
+		label = fmt.Sprintf("rollback %s steps", options[0])
+
+	case "rollback-to":
+		if len(options) == 0 {
+			return errors.New("Please specify a target migration name")
+		}
+		names, err = planRollbackTo(db, options[0])
+		label = "rollback to " + options[0]
+
+	default:
+		return errors.Errorf("unsupported plan command: %q", cmd)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	printPlan(label, names)
+	return nil
+}
+
+func printPlan(label string, names []string) {
+	if len(names) == 0 {
+		pkgLogger.Infof("%s: nothing to do", label)
+		return
+	}
+
+	pkgLogger.Infof("%s: %d migrations", label, len(names))
+	for _, name := range names {
+		pkgLogger.Infof("  %s", name)
+	}
+}
+
+func planMigrate(db *pg.DB, target string) ([]string, error) {
+	if target != "" {
+		if _, ok := allMigrations[target]; !ok {
+			return nil, errors.Errorf("unknown migration: %q", target)
+		}
+
+		completed, err := getCompletedMigrationsIfTableExists(db)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := checkMonotonicTarget(target, completed); err != nil {
+			return nil, err
+		}
+	}
+
+	migrationsToRun, err := getMigrationsToRunIfTableExists(db)
+	if err != nil {
+		return nil, err
+	}
+
+	if target == "" {
+		return migrationsToRun, nil
+	}
+
+	return migrationsUpTo(migrationsToRun, target), nil
+}
+
+func planRollback(db *pg.DB) ([]string, error) {
+	completed, err := getCompletedMigrationsIfTableExists(db)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkMigrationsTableNotCorrupt(completed); err != nil {
+		return nil, err
+	}
+
+	if len(completed) == 0 {
+		return nil, nil
+	}
+
+	batch, err := getBatchNumber(db)
+	if err != nil {
+		return nil, err
+	}
+
+	names, err := getMigrationsInBatch(db, batch)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		switch strings.Compare(names[i], names[j]) {
+		case -1:
+			return false
+		case 1:
+			return true
+		}
+		return false
+	})
+
+	return names, nil
+}
+
+func planRollbackSteps(db *pg.DB, n int) ([]string, error) {
+	if n <= 0 {
+		return nil, errors.Errorf("steps must be a positive number, got %d", n)
+	}
+
+	completed, err := getCompletedMigrationsOrderedIfTableExists(db)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkMigrationsTableNotCorrupt(completed); err != nil {
+		return nil, err
+	}
+
+	if n > len(completed) {
+		n = len(completed)
+	}
+
+	return completed[:n], nil
+}
+
+func planRollbackTo(db *pg.DB, name string) ([]string, error) {
+	if _, ok := allMigrations[name]; !ok {
+		return nil, errors.Errorf("unknown migration: %q", name)
+	}
+
+	completed, err := getCompletedMigrationsOrderedIfTableExists(db)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkMigrationsTableNotCorrupt(completed); err != nil {
+		return nil, err
+	}
+
+	found := false
+	var names []string
+	for _, c := range completed {
+		if c == name {
+			found = true
+			break
+		}
+		names = append(names, c)
+	}
+
+	if !found {
+		return nil, errors.Errorf("migration %q has not been applied", name)
+	}
+
+	return names, nil
+}
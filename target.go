@@ -0,0 +1,254 @@
+package migrations
+
+import (
+	"sort"
+
+	"github.com/go-pg/pg/v9"
+	"github.com/go-pg/pg/v9/orm"
+	"github.com/pkg/errors"
+)
+
+// MigrateTo runs all pending migrations up to and including the named
+// migration, in ascending name order, inside a single transaction.
+// It is useful for pinning a database to an exact migration id, e.g. when
+// bisecting a bad migration or provisioning an ephemeral environment.
+// MigrateTo errors before running any DDL if name is unknown, or if a
+// migration that sorts after name has already been applied.
+func MigrateTo(db *pg.DB, name string) error {
+	if _, ok := allMigrations[name]; !ok {
+		return errors.Errorf("unknown migration: %q", name)
+	}
+
+	return withAdvisoryLock(db, func() error {
+		return runInMutatingTransaction(db, func(tx *pg.Tx) (err error) {
+			var completed []string
+			completed, err = getCompletedMigrationsIfTableExists(tx)
+			if err != nil {
+				return
+			}
+
+			err = checkMonotonicTarget(name, completed)
+			if err != nil {
+				return
+			}
+
+			err = ensureMigrationsTable(tx)
+			if err != nil {
+				return
+			}
+
+			var migrationsToRun []string
+			migrationsToRun, err = getMigrationsToRun(tx)
+			if err != nil {
+				return
+			}
+
+			migrationsToRun = migrationsUpTo(migrationsToRun, name)
+			if len(migrationsToRun) == 0 {
+				return
+			}
+
+			var batch int
+			batch, err = getBatchNumber(tx)
+			if err != nil {
+				return
+			}
+			batch++
+
+			pkgLogger.Infof("Batch %d run: %d migrations", batch, len(migrationsToRun))
+
+			for _, migration := range migrationsToRun {
+				err = runMigrationUp(tx, migration)
+				if err != nil {
+					err = errors.Wrapf(err, "%s failed to migrate", migration)
+					return
+				}
+
+				err = insertCompletedMigration(tx, migration, batch)
+				if err != nil {
+					return
+				}
+			}
+
+			return
+		})
+	})
+}
+
+// RollbackSteps rolls back the n most recently applied migrations, in
+// reverse application order, across batch boundaries, inside a single
+// transaction.
+func RollbackSteps(db *pg.DB, n int) error {
+	if n <= 0 {
+		return errors.Errorf("steps must be a positive number, got %d", n)
+	}
+
+	return withAdvisoryLock(db, func() error {
+		return runInMutatingTransaction(db, func(tx *pg.Tx) (err error) {
+			var completed []string
+			completed, err = getCompletedMigrationsOrderedIfTableExists(tx)
+			if err != nil {
+				return
+			}
+
+			err = checkMigrationsTableNotCorrupt(completed)
+			if err != nil {
+				return
+			}
+
+			err = ensureMigrationsTable(tx)
+			if err != nil {
+				return
+			}
+
+			if n > len(completed) {
+				n = len(completed)
+			}
+
+			return rollbackMigrations(tx, completed[:n])
+		})
+	})
+}
+
+// RollbackTo rolls back every migration applied after name, in reverse
+// application order, across batch boundaries, inside a single transaction,
+// leaving name as the most recently applied migration. It errors before
+// running any DDL if name is unknown or has not been applied.
+func RollbackTo(db *pg.DB, name string) error {
+	if _, ok := allMigrations[name]; !ok {
+		return errors.Errorf("unknown migration: %q", name)
+	}
+
+	return withAdvisoryLock(db, func() error {
+		return runInMutatingTransaction(db, func(tx *pg.Tx) (err error) {
+			var completed []string
+			completed, err = getCompletedMigrationsOrderedIfTableExists(tx)
+			if err != nil {
+				return
+			}
+
+			err = checkMigrationsTableNotCorrupt(completed)
+			if err != nil {
+				return
+			}
+
+			found := false
+			var toRollback []string
+			for _, c := range completed {
+				if c == name {
+					found = true
+					break
+				}
+				toRollback = append(toRollback, c)
+			}
+
+			if !found {
+				err = errors.Errorf("migration %q has not been applied", name)
+				return
+			}
+
+			err = ensureMigrationsTable(tx)
+			if err != nil {
+				return
+			}
+
+			return rollbackMigrations(tx, toRollback)
+		})
+	})
+}
+
+func rollbackMigrations(tx *pg.Tx, names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+
+	pkgLogger.Infof("Rolling back %d migrations", len(names))
+
+	for _, name := range names {
+		if err := runMigrationDown(tx, name); err != nil {
+			return errors.Wrapf(err, "%s failed to rollback", name)
+		}
+
+		if err := removeRolledbackMigration(tx, name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func getCompletedMigrationsOrdered(db orm.DB) ([]string, error) {
+	var results []string
+
+	_, err := db.Query(&results, "select name from ? order by id desc", pg.Q(migrationTableName))
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// getCompletedMigrationsOrderedIfTableExists is getCompletedMigrationsOrdered,
+// except it returns an empty result instead of a SQL error when
+// migrationTableName hasn't been created yet.
+func getCompletedMigrationsOrderedIfTableExists(db orm.DB) ([]string, error) {
+	exists, err := migrationsTableExists(db)
+	if err != nil || !exists {
+		return nil, err
+	}
+
+	return getCompletedMigrationsOrdered(db)
+}
+
+func checkMigrationsTableNotCorrupt(completed []string) error {
+	missing := difference(completed, migrationNames)
+	if len(missing) > 0 {
+		return errors.Errorf("Migrations table corrupt: %+v", missing)
+	}
+	return nil
+}
+
+func checkMonotonicTarget(name string, completed []string) error {
+	sorted := sortedMigrationNames()
+	idx := migrationPosition(sorted, name)
+	if idx < 0 {
+		return errors.Errorf("unknown migration: %q", name)
+	}
+
+	for _, c := range completed {
+		if migrationPosition(sorted, c) > idx {
+			return errors.Errorf("migration %q is older than already applied migration %q", name, c)
+		}
+	}
+
+	return nil
+}
+
+func migrationsUpTo(pending []string, name string) []string {
+	sorted := sortedMigrationNames()
+	idx := migrationPosition(sorted, name)
+
+	result := make([]string, 0, len(pending))
+	for _, m := range pending {
+		if migrationPosition(sorted, m) <= idx {
+			result = append(result, m)
+		}
+	}
+
+	return result
+}
+
+func sortedMigrationNames() []string {
+	names := make([]string, len(migrationNames))
+	copy(names, migrationNames)
+	sort.Strings(names)
+	return names
+}
+
+func migrationPosition(sorted []string, name string) int {
+	idx := sort.SearchStrings(sorted, name)
+	if idx < len(sorted) && sorted[idx] == name {
+		return idx
+	}
+	return -1
+}
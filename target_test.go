@@ -0,0 +1,100 @@
+package migrations
+
+import (
+	"reflect"
+	"testing"
+)
+
+func withMigrationNames(t *testing.T, names []string, fn func()) {
+	t.Helper()
+	orig := migrationNames
+	migrationNames = names
+	defer func() { migrationNames = orig }()
+	fn()
+}
+
+func TestMigrationPosition(t *testing.T) {
+	sorted := []string{"a", "b", "c"}
+
+	cases := []struct {
+		name string
+		want int
+	}{
+		{"a", 0},
+		{"b", 1},
+		{"c", 2},
+		{"missing", -1},
+	}
+
+	for _, c := range cases {
+		if got := migrationPosition(sorted, c.name); got != c.want {
+			t.Errorf("migrationPosition(%v, %q) = %d, want %d", sorted, c.name, got, c.want)
+		}
+	}
+}
+
+func TestMigrationsUpTo(t *testing.T) {
+	withMigrationNames(t, []string{"1_a", "2_b", "3_c", "4_d"}, func() {
+		pending := []string{"2_b", "3_c", "4_d"}
+
+		got := migrationsUpTo(pending, "3_c")
+		want := []string{"2_b", "3_c"}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("migrationsUpTo(%v, %q) = %v, want %v", pending, "3_c", got, want)
+		}
+	})
+}
+
+func TestCheckMonotonicTarget(t *testing.T) {
+	withMigrationNames(t, []string{"1_a", "2_b", "3_c", "4_d"}, func() {
+		cases := []struct {
+			name      string
+			target    string
+			completed []string
+			wantError bool
+		}{
+			{
+				name:      "target unknown",
+				target:    "unknown",
+				completed: nil,
+				wantError: true,
+			},
+			{
+				name:      "target already applied",
+				target:    "2_b",
+				completed: []string{"1_a", "2_b"},
+				wantError: false,
+			},
+			{
+				name:      "target newer than everything applied",
+				target:    "3_c",
+				completed: []string{"1_a", "2_b"},
+				wantError: false,
+			},
+			{
+				name:      "target older than an applied migration",
+				target:    "2_b",
+				completed: []string{"1_a", "3_c"},
+				wantError: true,
+			},
+			{
+				name:      "nothing applied yet",
+				target:    "2_b",
+				completed: nil,
+				wantError: false,
+			},
+		}
+
+		for _, c := range cases {
+			t.Run(c.name, func(t *testing.T) {
+				err := checkMonotonicTarget(c.target, c.completed)
+				if c.wantError && err == nil {
+					t.Fatalf("expected error, got none")
+				}
+				if !c.wantError && err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			})
+		}
+	})
+}